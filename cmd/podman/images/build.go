@@ -3,6 +3,7 @@ package images
 import (
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/containers/buildah"
@@ -11,6 +12,7 @@ import (
 	"github.com/containers/buildah/pkg/parse"
 	"github.com/containers/common/pkg/completion"
 	"github.com/containers/common/pkg/config"
+	"github.com/containers/image/v5/docker/reference"
 	"github.com/containers/podman/v2/cmd/podman/common"
 	"github.com/containers/podman/v2/cmd/podman/registry"
 	"github.com/containers/podman/v2/cmd/podman/utils"
@@ -34,6 +36,41 @@ type buildFlagsWrapper struct {
 
 	// SquashAll squashes all layers into a single layer.
 	SquashAll bool
+
+	// Platforms is a list of os/arch[/variant] triples to build for.  When
+	// more than one platform is given, or --manifest is set, the resulting
+	// images are assembled into a manifest list (or appended to one) that
+	// carries the --tag names, rather than being tagged individually.
+	Platforms []string
+	// Manifest is the name of the manifest list to append the build's
+	// output to, creating it if it does not already exist.
+	Manifest string
+	// PlatformContinueOnError allows a multi-platform build to keep going,
+	// and still assemble a manifest list from the platforms that
+	// succeeded, when one or more platforms fail to build.
+	PlatformContinueOnError bool
+
+	// CacheFrom is a list of images to consult for reusable cached layers.
+	CacheFrom []string
+	// CacheTo is a list of images (optionally suffixed with ,mode=min or
+	// ,mode=max) to push cache layers to once the build completes.
+	CacheTo []string
+
+	// Secrets is a list of id=ID,src=PATH[,env=NAME] secrets made available
+	// to RUN instructions that request them via --mount=type=secret.
+	Secrets []string
+	// SSH is a list of default|ID[=PATH] SSH agent sockets or keys forwarded
+	// to RUN instructions that request them via --mount=type=ssh.
+	SSH []string
+
+	// SBOM configures generation of a software bill of materials for the
+	// built image, e.g. preset=syft or
+	// generator=IMAGE,scanner=CMD,format=spdx-json,output=PATH.
+	SBOM string
+
+	// Output is a list of type=TYPE,dest=PATH exporters to write the
+	// build's result to, bypassing the local image store.
+	Output []string
 }
 
 var (
@@ -96,6 +133,15 @@ func buildFlags(cmd *cobra.Command) {
 
 	// Podman flags
 	flags.BoolVarP(&buildOpts.SquashAll, "squash-all", "", false, "Squash all layers into a single layer")
+	flags.StringArrayVar(&buildOpts.Platforms, "platform", nil, "set the OS/ARCH[/VARIANT] to build for (may be used more than once, or as a comma-separated list, to build a manifest list)")
+	flags.StringVar(&buildOpts.Manifest, "manifest", "", "add the resulting image to a manifest list, creating the list if necessary")
+	flags.BoolVar(&buildOpts.PlatformContinueOnError, "platform-continue-on-error", false, "assemble a manifest list from the platforms that succeed even if others fail")
+	flags.StringArrayVar(&buildOpts.CacheFrom, "cache-from", nil, "best-effort: pull image(s) into local storage for opportunistic layer reuse, not a per-instruction remote cache (may be used more than once)")
+	flags.StringArrayVar(&buildOpts.CacheTo, "cache-to", nil, "best-effort: push the final image for later --cache-from reuse, optionally with ,mode=min|max (both modes currently push the full image) (may be used more than once)")
+	flags.StringArrayVar(&buildOpts.Secrets, "secret", nil, "secret file to expose to the build, id=ID,src=PATH[,env=NAME] (may be used more than once)")
+	flags.StringArrayVar(&buildOpts.SSH, "ssh", nil, "SSH agent socket or keys to expose to the build, default|ID[=PATH] (may be used more than once)")
+	flags.StringVar(&buildOpts.SBOM, "sbom", "", "generate a software bill of materials for the built image, preset=NAME or generator=IMAGE,scanner=CMD,format=FORMAT,output=PATH[,image-output=PATH][,merge-strategy=cat|merge][,attach-referrer=true|false (not yet implemented)]")
+	flags.StringArrayVar(&buildOpts.Output, "output", nil, "export the build result, type=local|tar|oci|oci-archive|docker,dest=PATH (may be used more than once)")
 
 	// Bud flags
 	budFlags := buildahCLI.GetBudFlags(&buildOpts.BudResults)
@@ -392,6 +438,44 @@ func buildFlagsWrapperToOptions(c *cobra.Command, contextDir string, flags *buil
 		runtimeFlags = append(runtimeFlags, "--"+arg)
 	}
 
+	platforms, err := parsePlatforms(flags.Platforms)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheFrom, err := parseCacheFrom(flags.CacheFrom)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheTo, err := parseCacheTo(flags.CacheTo)
+	if err != nil {
+		return nil, err
+	}
+	if len(platforms) > 1 && flags.Manifest == "" && output == "" {
+		return nil, errors.Errorf("building for multiple platforms requires --manifest or --tag")
+	}
+
+	secrets, err := parseSecrets(flags.Secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	sshSources, err := parseSSHSources(flags.SSH)
+	if err != nil {
+		return nil, err
+	}
+
+	sbom, err := parseSBOMOptions(flags.SBOM)
+	if err != nil {
+		return nil, err
+	}
+
+	exporters, err := parseExporters(flags.Output)
+	if err != nil {
+		return nil, err
+	}
+
 	containerConfig := registry.PodmanConfig()
 	for _, arg := range containerConfig.RuntimeFlags {
 		runtimeFlags = append(runtimeFlags, "--"+arg)
@@ -457,5 +541,262 @@ func buildFlagsWrapperToOptions(c *cobra.Command, contextDir string, flags *buil
 		TransientMounts:         flags.Volumes,
 	}
 
-	return &entities.BuildOptions{BuildOptions: opts}, nil
+	return &entities.BuildOptions{
+		BuildOptions:            opts,
+		Platforms:               platforms,
+		ManifestName:            flags.Manifest,
+		PlatformContinueOnError: flags.PlatformContinueOnError,
+		CacheFrom:               cacheFrom,
+		CacheTo:                 cacheTo,
+		Secrets:                 secrets,
+		SSHSources:              sshSources,
+		SBOM:                    sbom,
+		Exporters:               exporters,
+	}, nil
+}
+
+// validExporterTypes are the exporter types accepted by --output, mirroring
+// BuildKit's exporter names.
+var validExporterTypes = map[string]bool{
+	"local":       true,
+	"tar":         true,
+	"oci":         true,
+	"oci-archive": true,
+	"docker":      true,
+}
+
+// parseExporters parses the type=TYPE,dest=PATH values given to --output.
+func parseExporters(rawOutputs []string) ([]entities.BuildExporter, error) {
+	var exporters []entities.BuildExporter
+	for _, rawOutput := range rawOutputs {
+		exporter := entities.BuildExporter{}
+		for _, field := range strings.Split(rawOutput, ",") {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, errors.Errorf("invalid --output field %q: must be key=value", field)
+			}
+			switch kv[0] {
+			case "type":
+				exporter.Type = kv[1]
+			case "dest":
+				exporter.Dest = kv[1]
+			default:
+				return nil, errors.Errorf("invalid --output field %q: unrecognized key", field)
+			}
+		}
+		if !validExporterTypes[exporter.Type] {
+			return nil, errors.Errorf("invalid --output type %q: must be one of local, tar, oci, oci-archive, docker", exporter.Type)
+		}
+		if exporter.Dest == "" {
+			return nil, errors.Errorf("invalid --output %q: dest is required", rawOutput)
+		}
+		exporters = append(exporters, exporter)
+	}
+	return exporters, nil
+}
+
+// sbomPresets expand a well-known --sbom=preset=NAME value to the
+// generator/scanner/format triple it stands for, so users don't have to
+// spell out the full flag.
+var sbomPresets = map[string]entities.BuildSBOMOptions{
+	"syft": {
+		Generator: "docker.io/anchore/syft:latest",
+		Scanner:   "syft scan --output spdx-json dir:/scan",
+		Format:    "spdx-json",
+	},
+	"trivy": {
+		Generator: "docker.io/aquasec/trivy:latest",
+		Scanner:   "trivy filesystem --format cyclonedx /scan",
+		Format:    "cyclonedx-json",
+	},
+}
+
+// parseSBOMOptions parses the value given to --sbom, either a built-in
+// preset name or a comma-separated key=value list.
+func parseSBOMOptions(rawSBOM string) (*entities.BuildSBOMOptions, error) {
+	if rawSBOM == "" {
+		return nil, nil
+	}
+
+	fields := strings.Split(rawSBOM, ",")
+	if len(fields) == 1 && !strings.Contains(fields[0], "=") {
+		preset, ok := sbomPresets[fields[0]]
+		if !ok {
+			return nil, errors.Errorf("invalid --sbom preset %q", fields[0])
+		}
+		return &preset, nil
+	}
+
+	sbom := entities.BuildSBOMOptions{MergeStrategy: "cat"}
+	for _, field := range fields {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 {
+			return nil, errors.Errorf("invalid --sbom field %q: must be key=value", field)
+		}
+		switch kv[0] {
+		case "preset":
+			preset, ok := sbomPresets[kv[1]]
+			if !ok {
+				return nil, errors.Errorf("invalid --sbom preset %q", kv[1])
+			}
+			mergeStrategy := sbom.MergeStrategy
+			sbom = preset
+			sbom.MergeStrategy = mergeStrategy
+		case "generator":
+			sbom.Generator = kv[1]
+		case "scanner":
+			sbom.Scanner = kv[1]
+		case "format":
+			sbom.Format = kv[1]
+		case "output":
+			sbom.Output = kv[1]
+		case "image-output":
+			sbom.ImageOutput = kv[1]
+		case "merge-strategy":
+			sbom.MergeStrategy = kv[1]
+		case "attach-referrer":
+			attachReferrer, err := strconv.ParseBool(kv[1])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid --sbom field %q", field)
+			}
+			sbom.AttachReferrer = attachReferrer
+		default:
+			return nil, errors.Errorf("invalid --sbom field %q: unrecognized key", field)
+		}
+	}
+
+	if sbom.Generator == "" || sbom.Scanner == "" {
+		return nil, errors.Errorf("--sbom requires generator and scanner, or a preset")
+	}
+	if sbom.MergeStrategy != "cat" && sbom.MergeStrategy != "merge" {
+		return nil, errors.Errorf("invalid --sbom merge-strategy %q: must be cat or merge", sbom.MergeStrategy)
+	}
+
+	return &sbom, nil
+}
+
+// parseSecrets validates the id=ID,src=PATH[,env=NAME] values given to
+// --secret and returns them unchanged for the engine's run-mount machinery.
+// Validating src/env here, instead of waiting for the first RUN instruction
+// that mounts the secret, turns a typo'd path into an immediate error rather
+// than a build that silently never sees the secret it expected.
+func parseSecrets(rawSecrets []string) ([]string, error) {
+	for _, rawSecret := range rawSecrets {
+		var id, src, env string
+		for _, field := range strings.Split(rawSecret, ",") {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 {
+				return nil, errors.Errorf("invalid secret field %q: must be key=value", field)
+			}
+			switch kv[0] {
+			case "id":
+				id = kv[1]
+			case "src":
+				src = kv[1]
+			case "env":
+				env = kv[1]
+			default:
+				return nil, errors.Errorf("invalid secret field %q: unrecognized key", field)
+			}
+		}
+		if id == "" {
+			return nil, errors.Errorf("invalid secret %q: id is required", rawSecret)
+		}
+		switch {
+		case src != "" && env != "":
+			return nil, errors.Errorf("invalid secret %q: src and env are mutually exclusive", rawSecret)
+		case src != "":
+			if !utils.FileExists(src) {
+				return nil, errors.Errorf("invalid secret %q: no such file %q", rawSecret, src)
+			}
+		case env != "":
+			if _, ok := os.LookupEnv(env); !ok {
+				return nil, errors.Errorf("invalid secret %q: environment variable %q is not set", rawSecret, env)
+			}
+		default:
+			return nil, errors.Errorf("invalid secret %q: one of src or env is required", rawSecret)
+		}
+	}
+	return rawSecrets, nil
+}
+
+// parseSSHSources validates the default|ID[=PATH] values given to --ssh and
+// returns them unchanged for the engine's SSH-forwarding machinery.
+func parseSSHSources(rawSources []string) ([]string, error) {
+	for _, rawSource := range rawSources {
+		kv := strings.SplitN(rawSource, "=", 2)
+		if kv[0] == "" {
+			return nil, errors.Errorf("invalid ssh source %q: id is required", rawSource)
+		}
+		if len(kv) == 2 {
+			for _, path := range strings.Split(kv[1], ",") {
+				if !utils.FileExists(path) {
+					return nil, errors.Errorf("invalid ssh source %q: no such file %q", rawSource, path)
+				}
+			}
+		}
+	}
+	return rawSources, nil
+}
+
+// parsePlatforms splits and validates the os/arch[/variant] triples given to
+// --platform.  Each entry in rawPlatforms may itself be a comma-separated
+// list.
+func parsePlatforms(rawPlatforms []string) ([]entities.BuildPlatform, error) {
+	var platforms []entities.BuildPlatform
+	for _, rawPlatform := range rawPlatforms {
+		for _, p := range strings.Split(rawPlatform, ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			parts := strings.Split(p, "/")
+			if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+				return nil, errors.Errorf("invalid platform %q: must be in OS/ARCH[/VARIANT] format", p)
+			}
+			platform := entities.BuildPlatform{OS: parts[0], Arch: parts[1]}
+			if len(parts) == 3 {
+				platform.Variant = parts[2]
+			}
+			platforms = append(platforms, platform)
+		}
+	}
+	return platforms, nil
+}
+
+// parseCacheFrom validates the image references given to --cache-from.
+func parseCacheFrom(rawRefs []string) ([]string, error) {
+	var refs []string
+	for _, rawRef := range rawRefs {
+		if _, err := reference.ParseNormalizedNamed(rawRef); err != nil {
+			return nil, errors.Wrapf(err, "invalid --cache-from reference %q", rawRef)
+		}
+		refs = append(refs, rawRef)
+	}
+	return refs, nil
+}
+
+// parseCacheTo validates and splits the REF[,mode=min|max] values given to
+// --cache-to.
+func parseCacheTo(rawTargets []string) ([]entities.BuildCacheTarget, error) {
+	var targets []entities.BuildCacheTarget
+	for _, rawTarget := range rawTargets {
+		fields := strings.Split(rawTarget, ",")
+		target := entities.BuildCacheTarget{Reference: fields[0], Mode: "min"}
+		for _, field := range fields[1:] {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) != 2 || kv[0] != "mode" {
+				return nil, errors.Errorf("invalid --cache-to field %q: only mode=min|max is supported", field)
+			}
+			target.Mode = kv[1]
+		}
+		if target.Mode != "min" && target.Mode != "max" {
+			return nil, errors.Errorf("invalid --cache-to mode %q: must be min or max", target.Mode)
+		}
+		if _, err := reference.ParseNormalizedNamed(target.Reference); err != nil {
+			return nil, errors.Wrapf(err, "invalid --cache-to reference %q", target.Reference)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
 }
@@ -0,0 +1,55 @@
+package images
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSecrets(t *testing.T) {
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret.txt")
+	require.NoError(t, os.WriteFile(secretFile, []byte("sekret"), 0600))
+	t.Setenv("MY_SECRET_ENV", "sekret")
+
+	valid, err := parseSecrets([]string{
+		"id=mysecret,src=" + secretFile,
+		"id=other,env=MY_SECRET_ENV",
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"id=mysecret,src=" + secretFile,
+		"id=other,env=MY_SECRET_ENV",
+	}, valid)
+
+	_, err = parseSecrets([]string{"src=" + secretFile})
+	assert.Error(t, err, "id is required")
+
+	_, err = parseSecrets([]string{"id=mysecret,src=/no/such/file"})
+	assert.Error(t, err, "src must point at an existing file")
+
+	_, err = parseSecrets([]string{"id=mysecret,env=MY_UNSET_SECRET_ENV"})
+	assert.Error(t, err, "env must be set")
+
+	_, err = parseSecrets([]string{"id=mysecret"})
+	assert.Error(t, err, "one of src or env is required")
+
+	_, err = parseSecrets([]string{"id=mysecret,src=" + secretFile + ",env=MY_SECRET_ENV"})
+	assert.Error(t, err, "src and env are mutually exclusive")
+}
+
+func TestParseSSHSources(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "id_rsa")
+	require.NoError(t, os.WriteFile(keyFile, []byte("key"), 0600))
+
+	valid, err := parseSSHSources([]string{"default", "work=" + keyFile})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"default", "work=" + keyFile}, valid)
+
+	_, err = parseSSHSources([]string{"work=/no/such/key"})
+	assert.Error(t, err, "path must point at an existing file")
+}
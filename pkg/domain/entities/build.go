@@ -0,0 +1,115 @@
+package entities
+
+import (
+	"github.com/containers/buildah/imagebuildah"
+)
+
+// BuildOptions describes the options for building an image from a
+// Containerfile.  It embeds the Buildah options so the ABI implementation
+// can hand them straight to imagebuildah, and carries the Podman-specific
+// extensions (multi-platform, manifest lists, secrets, SBOMs, exporters, ...)
+// that imagebuildah itself does not know about.
+type BuildOptions struct {
+	imagebuildah.BuildOptions
+
+	// Platforms is the set of OS/Arch[/Variant] triples to build for.  When
+	// it has more than one entry, the engine builds each platform in turn
+	// and assembles the results into a manifest list rather than
+	// committing a single image.
+	Platforms []BuildPlatform
+	// ManifestName is the manifest list the build's output should be
+	// appended to, creating it if it does not already exist.
+	ManifestName string
+	// PlatformContinueOnError keeps a multi-platform build going after a
+	// platform fails, assembling the manifest list from the platforms
+	// that succeeded instead of aborting the whole build.
+	PlatformContinueOnError bool
+
+	// CacheFrom is a list of images consulted for reusable cached layers
+	// before each instruction is run.
+	CacheFrom []string
+	// CacheTo is a list of images that reusable layers built during this
+	// build are pushed to once it completes.
+	CacheTo []BuildCacheTarget
+
+	// Secrets are made available to RUN instructions that request them via
+	// --mount=type=secret, in "id=ID,src=PATH" or "id=ID,env=NAME" form.
+	// They are never written into a committed layer.
+	Secrets []string
+	// SSHSources are SSH agent sockets or keys forwarded to RUN
+	// instructions that request them via --mount=type=ssh, in
+	// "default" or "ID[=PATH]" form.
+	SSHSources []string
+
+	// SBOM configures generation of a software bill of materials for the
+	// build's output.  Nil means no SBOM is generated.
+	SBOM *BuildSBOMOptions
+
+	// Exporters write the build's result to destinations other than the
+	// local image store.
+	Exporters []BuildExporter
+}
+
+// BuildPlatform is a single OS/Arch/Variant triple requested via --platform.
+type BuildPlatform struct {
+	OS      string
+	Arch    string
+	Variant string
+}
+
+// BuildCacheTarget is a single --cache-to destination.
+type BuildCacheTarget struct {
+	// Reference is the image cache layers are pushed to.
+	Reference string
+	// Mode is "min" (push only the layers needed to reproduce the final
+	// image) or "max" (push every intermediate layer).  The ABI engine
+	// currently pushes the same full final image for both modes; see
+	// exportBuildCache's doc comment for why.
+	Mode string
+}
+
+// BuildSBOMOptions configures how a software bill of materials is generated
+// for a build, and where the result ends up.
+type BuildSBOMOptions struct {
+	// Generator is the image used to run Scanner in.
+	Generator string
+	// Scanner is the command run inside Generator against the built
+	// rootfs to produce the SBOM.
+	Scanner string
+	// Format is the SBOM's output format, e.g. spdx-json or
+	// cyclonedx-json.
+	Format string
+	// Output is the host path the SBOM document is written to.
+	Output string
+	// ImageOutput, if set, embeds the SBOM in the built image as an
+	// extra layer at this in-image path.
+	ImageOutput string
+	// MergeStrategy controls how per-platform/per-stage SBOMs are
+	// combined: "cat" writes one document per platform, "merge" combines
+	// them into a single document, deduplicating components by PURL.
+	MergeStrategy string
+	// AttachReferrer requests that the SBOM be attached to the pushed image
+	// as an OCI referrer manifest (artifactType/subject) instead of, or in
+	// addition to, Output/ImageOutput. NOT IMPLEMENTED YET: the push path
+	// does not attach referrer manifests, so the engine rejects this rather
+	// than silently building the image without one.
+	AttachReferrer bool
+}
+
+// BuildExporter writes a build's result to a destination other than the
+// local image store, analogous to a BuildKit exporter.
+type BuildExporter struct {
+	// Type is one of local, tar, oci, oci-archive, or docker.
+	Type string
+	// Dest is the destination path ("-" means stdout for tar).
+	Dest string
+}
+
+// BuildReport is the result of a successful image build.
+type BuildReport struct {
+	// ID is the built image's ID, or the manifest list's ID when more
+	// than one platform was built or ManifestName was set.  It is empty
+	// when the image was only written out through Exporters and, having
+	// no tag, was not kept in the local store.
+	ID string
+}
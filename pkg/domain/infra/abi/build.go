@@ -0,0 +1,317 @@
+package abi
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/containers/buildah"
+	"github.com/containers/buildah/imagebuildah"
+	"github.com/containers/buildah/pkg/manifests"
+	"github.com/containers/common/libimage"
+	"github.com/containers/common/pkg/config"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/podman/v2/libpod"
+	"github.com/containers/podman/v2/pkg/domain/entities"
+	"github.com/containers/storage"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ImageEngine is the local (ABI) implementation of entities.ImageEngine.
+// Image-related methods of this engine, including Build, live in this
+// package's files, each handling the API for one or a few closely related
+// commands.
+type ImageEngine struct {
+	Libpod *libpod.Runtime
+}
+
+// Build builds an image from the given Containerfiles.  When more than one
+// platform is requested, or a single (or no) platform is requested with
+// --manifest, it instead builds a manifest list of per-platform images,
+// appending to --manifest's list if one by that name already exists.
+func (ir *ImageEngine) Build(ctx context.Context, containerFiles []string, opts entities.BuildOptions) (*entities.BuildReport, error) {
+	store := ir.Libpod.GetStore()
+
+	if err := importBuildCache(ctx, store, opts.CacheFrom); err != nil {
+		return nil, err
+	}
+	applyRunMounts(&opts.BuildOptions, opts.Secrets, opts.SSHSources)
+
+	// A single (or no) platform with no --manifest is the plain,
+	// non-manifest-list build: commit one image and return.  Everything
+	// else -- more than one platform, or even a single/no platform that's
+	// being appended to a named manifest list (so a manifest list can be
+	// built up one platform at a time across separate invocations) -- goes
+	// through the per-platform build-and-assemble path below.
+	if len(opts.Platforms) <= 1 && opts.ManifestName == "" {
+		if len(opts.Platforms) == 1 {
+			setPlatform(&opts.BuildOptions, opts.Platforms[0])
+		}
+		imageID, _, err := imagebuildah.BuildDockerfiles(ctx, store, opts.BuildOptions, containerFiles)
+		if err != nil {
+			return nil, err
+		}
+		imageID, _, err = finishImage(ctx, store, imageID, opts.SBOM, opts.CacheTo, opts.Exporters)
+		if err != nil {
+			return nil, err
+		}
+		if len(opts.Exporters) > 0 && opts.BuildOptions.Output == "" && len(opts.BuildOptions.AdditionalTags) == 0 {
+			if _, err := store.DeleteImage(imageID, true); err != nil {
+				logrus.Warnf("removing untagged build result %s after export: %v", imageID, err)
+			}
+			return &entities.BuildReport{}, nil
+		}
+		return &entities.BuildReport{ID: imageID}, nil
+	}
+
+	// implicitPlatform is true when the caller gave no --platform at all but
+	// is still appending to a manifest list via --manifest; in that case
+	// there's exactly one (host-default) platform to build and setPlatform
+	// must not override it with a zero-value entities.BuildPlatform.
+	platforms := opts.Platforms
+	implicitPlatform := len(platforms) == 0
+	if implicitPlatform {
+		platforms = []entities.BuildPlatform{{}}
+	}
+
+	type platformResult struct {
+		platform entities.BuildPlatform
+		imageID  string
+		err      error
+	}
+
+	results := make([]platformResult, 0, len(platforms))
+	var sbomDocs [][]byte
+	for _, platform := range platforms {
+		platformOpts := opts.BuildOptions
+		// Per-platform images stay untagged: the --tag names go to the
+		// manifest list assembled below.
+		platformOpts.Output = ""
+		platformOpts.AdditionalTags = nil
+		if !implicitPlatform {
+			setPlatform(&platformOpts, platform)
+		}
+
+		sbom := opts.SBOM
+		exporters := opts.Exporters
+		if len(opts.Platforms) > 1 {
+			sbom = perPlatformSBOM(opts.SBOM, platform)
+			exporters = perPlatformExporters(opts.Exporters, platform)
+		}
+
+		imageID, _, err := imagebuildah.BuildDockerfiles(ctx, store, platformOpts, containerFiles)
+		var sbomDoc []byte
+		if err == nil {
+			imageID, sbomDoc, err = finishImage(ctx, store, imageID, sbom, opts.CacheTo, exporters)
+		}
+		if err != nil {
+			if !opts.PlatformContinueOnError {
+				return nil, errors.Wrapf(err, "building for platform %s/%s", platform.OS, platform.Arch)
+			}
+			logrus.Errorf("building for platform %s/%s: %v", platform.OS, platform.Arch, err)
+		} else if sbomDoc != nil {
+			sbomDocs = append(sbomDocs, sbomDoc)
+		}
+		results = append(results, platformResult{platform: platform, imageID: imageID, err: err})
+	}
+
+	if opts.SBOM != nil && opts.SBOM.MergeStrategy == "merge" && opts.SBOM.Output != "" {
+		merged, err := mergeSBOMDocuments(sbomDocs)
+		if err != nil {
+			return nil, errors.Wrap(err, "merging per-platform SBOMs")
+		}
+		if err := writeSBOMFile(opts.SBOM.Output, merged); err != nil {
+			return nil, errors.Wrapf(err, "writing merged SBOM to %q", opts.SBOM.Output)
+		}
+	}
+
+	list, err := loadOrCreateManifestList(store, opts.ManifestName)
+	if err != nil {
+		return nil, err
+	}
+	systemContext := opts.BuildOptions.SystemContext
+	if systemContext == nil {
+		systemContext = &types.SystemContext{}
+	}
+
+	built := 0
+	for _, result := range results {
+		if result.err != nil {
+			continue
+		}
+		if _, err := list.Add(ctx, systemContext, imageReference(result.imageID), false); err != nil {
+			return nil, errors.Wrapf(err, "adding %s/%s image to manifest list", result.platform.OS, result.platform.Arch)
+		}
+		built++
+	}
+	if built == 0 {
+		return nil, errors.New("no platform built successfully, nothing to assemble into a manifest list")
+	}
+
+	names := opts.BuildOptions.AdditionalTags
+	if opts.BuildOptions.Output != "" {
+		names = append([]string{opts.BuildOptions.Output}, names...)
+	}
+	if opts.ManifestName != "" {
+		names = append([]string{opts.ManifestName}, names...)
+	}
+	if len(names) == 0 {
+		return nil, errors.New("a manifest list requires --manifest or --tag")
+	}
+
+	listID, err := list.SaveToImage(store, "", names, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "saving manifest list")
+	}
+
+	return &entities.BuildReport{ID: listID}, nil
+}
+
+// finishImage runs the post-build steps common to every platform of a
+// build: exporting reusable layers to --cache-to, generating an SBOM (and
+// writing it out unless sbom.Output was cleared for later merging), and
+// running --output exporters.  It returns the (possibly new, if an SBOM got
+// embedded) image ID and the raw SBOM document, if one was generated, so
+// that a failure in any one step is reported the same way a Containerfile
+// build failure is, and --platform-continue-on-error covers it too.
+func finishImage(ctx context.Context, store storage.Store, imageID string, sbom *entities.BuildSBOMOptions, cacheTo []entities.BuildCacheTarget, exporters []entities.BuildExporter) (string, []byte, error) {
+	if err := exportBuildCache(ctx, store, imageID, cacheTo); err != nil {
+		return "", nil, errors.Wrap(err, "exporting build cache")
+	}
+
+	imageID, sbomDoc, err := generateSBOM(ctx, store, imageID, sbom)
+	if err != nil {
+		return "", nil, errors.Wrap(err, "generating SBOM")
+	}
+	if sbom != nil && sbom.Output != "" {
+		if err := writeSBOMFile(sbom.Output, sbomDoc); err != nil {
+			return "", nil, errors.Wrapf(err, "writing SBOM to %q", sbom.Output)
+		}
+	}
+
+	if err := exportBuild(ctx, store, imageID, exporters); err != nil {
+		return "", nil, errors.Wrap(err, "running --output exporters")
+	}
+
+	return imageID, sbomDoc, nil
+}
+
+// setPlatform points opts at the given platform, overriding whatever was set
+// via --os/--arch/--variant, and exports BUILDPLATFORM/TARGETPLATFORM to the
+// build as build-args so Containerfiles can branch on them.
+func setPlatform(opts *imagebuildah.BuildOptions, platform entities.BuildPlatform) {
+	opts.OS = platform.OS
+	opts.Architecture = platform.Arch
+
+	if opts.SystemContext == nil {
+		opts.SystemContext = &types.SystemContext{}
+	}
+	opts.SystemContext.OSChoice = platform.OS
+	opts.SystemContext.ArchitectureChoice = platform.Arch
+	opts.SystemContext.VariantChoice = platform.Variant
+
+	if opts.Args == nil {
+		opts.Args = make(map[string]string)
+	}
+	opts.Args["TARGETPLATFORM"] = fmt.Sprintf("%s/%s", platform.OS, platform.Arch)
+	opts.Args["BUILDPLATFORM"] = fmt.Sprintf("%s/%s", platform.OS, platform.Arch)
+}
+
+// applyRunMounts hands the validated --secret/--ssh values to Buildah's own
+// run-mount machinery, which bind-mounts each secret read-only for the
+// duration of the RUN instruction that requests it (and never writes it into
+// a committed layer) and forwards the named SSH agent over a per-RUN socket.
+func applyRunMounts(opts *imagebuildah.BuildOptions, secrets, sshSources []string) {
+	if len(secrets) == 0 && len(sshSources) == 0 {
+		return
+	}
+	if opts.CommonBuildOpts == nil {
+		opts.CommonBuildOpts = &buildah.CommonBuildOptions{}
+	}
+	opts.CommonBuildOpts.Secrets = secrets
+	opts.CommonBuildOpts.SSHSources = sshSources
+}
+
+// imageReference builds a "containers-storage:" transport reference string
+// for an image ID so it can be added to a manifest list.
+func imageReference(imageID string) string {
+	return fmt.Sprintf("containers-storage:@%s", imageID)
+}
+
+// loadOrCreateManifestList returns the manifest list already stored as name,
+// with its existing contents intact, so that building one platform at a time
+// across separate "podman build --manifest name" invocations appends to the
+// list instead of replacing it each time.  If no such manifest list exists
+// yet (including when name is empty, i.e. only --platform was given with
+// more than one platform and no --manifest), it returns a new, empty list.
+func loadOrCreateManifestList(store storage.Store, name string) (manifests.List, error) {
+	if name == "" {
+		return manifests.Create(), nil
+	}
+	image, err := store.Image(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrImageUnknown) {
+			return manifests.Create(), nil
+		}
+		return nil, errors.Wrapf(err, "looking up existing manifest list %q", name)
+	}
+	list, err := manifests.LoadFromImage(store, image.ID)
+	if err != nil {
+		return nil, errors.Wrapf(err, "loading existing manifest list %q", name)
+	}
+	return list, nil
+}
+
+// importBuildCache pulls each --cache-from image into local storage so that
+// imagebuildah's own layer-reuse logic can match instructions against their
+// layers without re-executing them.
+func importBuildCache(ctx context.Context, store storage.Store, cacheFrom []string) error {
+	if len(cacheFrom) == 0 {
+		return nil
+	}
+
+	runtime, err := libimage.RuntimeFromStore(store, &libimage.RuntimeOptions{})
+	if err != nil {
+		return errors.Wrap(err, "preparing to import build cache")
+	}
+
+	for _, ref := range cacheFrom {
+		if _, err := runtime.Pull(ctx, ref, config.PullPolicyNewer, &libimage.PullOptions{}); err != nil {
+			logrus.Warnf("importing build cache from %q: %v", ref, err)
+		}
+	}
+	return nil
+}
+
+// exportBuildCache pushes imageID to each --cache-to destination so that a
+// later build, possibly on another machine, can import it as a cache source.
+// Both mode=min and mode=max push the full final image today: true
+// per-layer export (mode=min exporting only the layers needed to reproduce
+// the final image, mode=max exporting every intermediate layer separately)
+// needs access to imagebuildah's own intermediate-layer bookkeeping, which
+// isn't exposed yet.
+func exportBuildCache(ctx context.Context, store storage.Store, imageID string, cacheTo []entities.BuildCacheTarget) error {
+	if imageID == "" || len(cacheTo) == 0 {
+		return nil
+	}
+
+	runtime, err := libimage.RuntimeFromStore(store, &libimage.RuntimeOptions{})
+	if err != nil {
+		return errors.Wrap(err, "preparing to export build cache")
+	}
+
+	image, _, err := runtime.LookupImage(imageID, nil)
+	if err != nil {
+		return errors.Wrapf(err, "looking up %q to export build cache", imageID)
+	}
+
+	for _, target := range cacheTo {
+		if err := image.Tag(target.Reference); err != nil {
+			return errors.Wrapf(err, "tagging build cache image %q", target.Reference)
+		}
+		if _, err := runtime.Push(ctx, image.ID(), target.Reference, &libimage.PushOptions{}); err != nil {
+			return errors.Wrapf(err, "exporting build cache to %q", target.Reference)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+package abi
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/containers/buildah"
+	"github.com/containers/image/v5/copy"
+	"github.com/containers/image/v5/signature"
+	"github.com/containers/image/v5/transports/alltransports"
+	"github.com/containers/image/v5/types"
+	"github.com/containers/podman/v2/pkg/domain/entities"
+	"github.com/containers/storage"
+	"github.com/containers/storage/pkg/archive"
+	"github.com/pkg/errors"
+)
+
+// copyImage copies an image between two containers/image references using
+// the same permissive (accept-anything) signature policy podman's build
+// path already trusts for locally produced images.
+func copyImage(ctx context.Context, srcRef, destRef types.ImageReference) error {
+	policy := &signature.Policy{Default: signature.PolicyRequirements{signature.NewPRInsecureAcceptAnything()}}
+	policyContext, err := signature.NewPolicyContext(policy)
+	if err != nil {
+		return err
+	}
+	defer policyContext.Destroy() //nolint:errcheck
+
+	_, err = copy.Image(ctx, policyContext, destRef, srcRef, &copy.Options{})
+	return err
+}
+
+// exportBuild writes imageID out through each requested exporter, bypassing
+// the local image store for destinations that don't need it.
+func exportBuild(ctx context.Context, store storage.Store, imageID string, exporters []entities.BuildExporter) error {
+	for _, exporter := range exporters {
+		if err := runExporter(ctx, store, imageID, exporter); err != nil {
+			return errors.Wrapf(err, "exporting to %s %q", exporter.Type, exporter.Dest)
+		}
+	}
+	return nil
+}
+
+func runExporter(ctx context.Context, store storage.Store, imageID string, exporter entities.BuildExporter) error {
+	switch exporter.Type {
+	case "local", "tar":
+		return exportRootfs(ctx, store, imageID, exporter)
+	case "oci", "oci-archive", "docker":
+		return exportImageLayout(ctx, imageID, exporter)
+	default:
+		return errors.Errorf("unsupported --output type %q", exporter.Type)
+	}
+}
+
+// exportRootfs mounts imageID's rootfs and, for "local", copies it into
+// exporter.Dest as a directory tree, or, for "tar", streams it as a tarball
+// to exporter.Dest (a path, or "-" for stdout).
+func exportRootfs(ctx context.Context, store storage.Store, imageID string, exporter entities.BuildExporter) error {
+	builder, err := buildah.NewBuilder(ctx, store, buildah.BuilderOptions{FromImage: imageID})
+	if err != nil {
+		return err
+	}
+	defer builder.Delete() //nolint:errcheck
+
+	rootfs, err := builder.Mount("")
+	if err != nil {
+		return err
+	}
+	defer builder.Unmount() //nolint:errcheck
+
+	if exporter.Type == "local" {
+		return copyDir(rootfs, exporter.Dest)
+	}
+
+	reader, err := archive.Tar(rootfs, archive.Uncompressed)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	out := os.Stdout
+	if exporter.Dest != "-" {
+		f, err := os.Create(exporter.Dest)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	_, err = io.Copy(out, reader)
+	return err
+}
+
+// exportImageLayout copies imageID from local storage to an OCI layout, an
+// oci-archive, or a docker-archive, using the same containers/image copy
+// machinery podman uses for push/pull.
+func exportImageLayout(ctx context.Context, imageID string, exporter entities.BuildExporter) error {
+	srcRef, err := alltransports.ParseImageName("containers-storage:@" + imageID)
+	if err != nil {
+		return err
+	}
+
+	transport := exporter.Type
+	if transport == "docker" {
+		transport = "docker-archive"
+	}
+	destRef, err := alltransports.ParseImageName(transport + ":" + exporter.Dest)
+	if err != nil {
+		return err
+	}
+
+	return copyImage(ctx, srcRef, destRef)
+}
+
+// perPlatformExporters suffixes each exporter's destination with the
+// platform so a multi-platform build doesn't have every platform overwrite
+// the same --output destination.
+func perPlatformExporters(exporters []entities.BuildExporter, platform entities.BuildPlatform) []entities.BuildExporter {
+	if len(exporters) == 0 {
+		return nil
+	}
+	suffixed := make([]entities.BuildExporter, len(exporters))
+	for i, exporter := range exporters {
+		suffixed[i] = exporter
+		if exporter.Dest != "-" {
+			suffixed[i].Dest = fmt.Sprintf("%s.%s-%s", exporter.Dest, platform.OS, platform.Arch)
+		}
+	}
+	return suffixed
+}
+
+// copyDir recursively copies src into dst, creating dst if necessary.
+func copyDir(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode())
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		}
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+		out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode())
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+		_, err = io.Copy(out, in)
+		return err
+	})
+}
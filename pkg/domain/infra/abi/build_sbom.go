@@ -0,0 +1,196 @@
+package abi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/containers/buildah"
+	"github.com/containers/podman/v2/pkg/domain/entities"
+	"github.com/containers/storage"
+	"github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/pkg/errors"
+)
+
+// sbomComponentKeys are, in order of preference, the top-level JSON array
+// holding a document's components: SPDX calls them "packages", CycloneDX
+// calls them "components".
+var sbomComponentKeys = []string{"packages", "components"}
+
+// generateSBOM runs opts.Scanner inside opts.Generator against imageID's
+// rootfs (mounted read-only), and, if requested, embeds the result into the
+// image as an extra layer at opts.ImageOutput.  It returns the ID of the
+// image carrying the embedded SBOM, which takes over imageID's tags
+// (imageID unchanged when ImageOutput is not set), and the raw SBOM document, which the caller is responsible for
+// writing to opts.Output (directly, or after merging with other platforms').
+func generateSBOM(ctx context.Context, store storage.Store, imageID string, opts *entities.BuildSBOMOptions) (string, []byte, error) {
+	if opts == nil {
+		return imageID, nil, nil
+	}
+	if opts.AttachReferrer {
+		return "", nil, errors.New("--sbom=attach-referrer=true is not implemented yet: attaching the SBOM to the pushed image as an OCI referrer manifest requires push-path support (artifactType/subject) that does not exist in this build")
+	}
+
+	target, err := buildah.NewBuilder(ctx, store, buildah.BuilderOptions{FromImage: imageID})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "reading %q to generate SBOM", imageID)
+	}
+	defer target.Delete() //nolint:errcheck
+
+	rootfs, err := target.Mount("")
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "mounting %q to generate SBOM", imageID)
+	}
+	defer target.Unmount() //nolint:errcheck
+
+	generator, err := buildah.NewBuilder(ctx, store, buildah.BuilderOptions{
+		FromImage:  opts.Generator,
+		PullPolicy: buildah.PullIfMissing,
+	})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "pulling SBOM generator %q", opts.Generator)
+	}
+	defer generator.Delete() //nolint:errcheck
+
+	var stdout bytes.Buffer
+	runErr := generator.Run(strings.Fields(opts.Scanner), buildah.RunOptions{
+		Mounts: []specs.Mount{{
+			Source:      rootfs,
+			Destination: "/scan",
+			Type:        "bind",
+			Options:     []string{"ro", "bind"},
+		}},
+		Stdout: &stdout,
+	})
+	if runErr != nil {
+		return "", nil, errors.Wrapf(runErr, "running SBOM scanner %q", opts.Scanner)
+	}
+	doc := stdout.Bytes()
+
+	if opts.ImageOutput == "" {
+		return imageID, doc, nil
+	}
+
+	sbomFile, err := os.CreateTemp("", "podman-sbom-")
+	if err != nil {
+		return "", nil, errors.Wrap(err, "creating temporary SBOM file")
+	}
+	defer os.Remove(sbomFile.Name())
+	if _, err := sbomFile.Write(doc); err != nil {
+		return "", nil, errors.Wrap(err, "writing temporary SBOM file")
+	}
+	sbomFile.Close()
+
+	embedder, err := buildah.NewBuilder(ctx, store, buildah.BuilderOptions{FromImage: imageID})
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "reading %q to embed SBOM", imageID)
+	}
+	defer embedder.Delete() //nolint:errcheck
+
+	if err := embedder.Add(opts.ImageOutput, false, buildah.AddAndCopyOptions{}, sbomFile.Name()); err != nil {
+		return "", nil, errors.Wrapf(err, "embedding SBOM at %q", opts.ImageOutput)
+	}
+
+	newImageID, _, _, err := embedder.Commit(ctx, nil, buildah.CommitOptions{})
+	if err != nil {
+		return "", nil, errors.Wrap(err, "committing image with embedded SBOM")
+	}
+	if image, err := store.Image(imageID); err == nil && len(image.Names) > 0 {
+		if err := store.SetNames(newImageID, image.Names); err != nil {
+			return "", nil, errors.Wrap(err, "moving tags to image with embedded SBOM")
+		}
+	}
+
+	return newImageID, doc, nil
+}
+
+// perPlatformSBOM adapts sbom for a single platform within a multi-platform
+// build: both strategies still run the scanner per platform, but "cat"
+// writes the doc straight to a per-platform file while "merge" suppresses
+// the per-platform write (Output cleared) so the caller can combine all
+// platforms' documents into one file once every platform has built.
+func perPlatformSBOM(sbom *entities.BuildSBOMOptions, platform entities.BuildPlatform) *entities.BuildSBOMOptions {
+	if sbom == nil {
+		return nil
+	}
+	platformSBOM := *sbom
+	switch sbom.MergeStrategy {
+	case "merge":
+		platformSBOM.Output = ""
+	default:
+		if sbom.Output != "" {
+			platformSBOM.Output = fmt.Sprintf("%s.%s-%s", sbom.Output, platform.OS, platform.Arch)
+		}
+	}
+	return &platformSBOM
+}
+
+// writeSBOMFile writes an SBOM document to disk, overwriting whatever was
+// there before.
+func writeSBOMFile(path string, data []byte) error {
+	return os.WriteFile(path, data, 0644)
+}
+
+// mergeSBOMDocuments combines the given SBOM documents into a single JSON
+// document, deduplicating components across documents.  Components are
+// compared by their "purl" field when present, falling back to deep
+// equality otherwise.
+func mergeSBOMDocuments(docs [][]byte) ([]byte, error) {
+	if len(docs) == 0 {
+		return nil, errors.New("no SBOM documents to merge")
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(docs[0], &merged); err != nil {
+		return nil, errors.Wrap(err, "parsing SBOM document")
+	}
+
+	componentKey := ""
+	for _, key := range sbomComponentKeys {
+		if _, ok := merged[key]; ok {
+			componentKey = key
+			break
+		}
+	}
+	if componentKey == "" {
+		return nil, errors.New("unrecognized SBOM format: no packages or components array found")
+	}
+
+	var components []interface{}
+	seen := map[string]bool{}
+	addComponents := func(raw []interface{}) {
+		for _, component := range raw {
+			key := ""
+			if m, ok := component.(map[string]interface{}); ok {
+				if purl, ok := m["purl"].(string); ok && purl != "" {
+					key = purl
+				}
+			}
+			if key == "" {
+				if encoded, err := json.Marshal(component); err == nil {
+					key = string(encoded)
+				}
+			}
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			components = append(components, component)
+		}
+	}
+
+	for _, doc := range docs {
+		var parsed map[string]interface{}
+		if err := json.Unmarshal(doc, &parsed); err != nil {
+			return nil, errors.Wrap(err, "parsing SBOM document")
+		}
+		raw, _ := parsed[componentKey].([]interface{})
+		addComponents(raw)
+	}
+
+	merged[componentKey] = components
+	return json.MarshalIndent(merged, "", "  ")
+}
@@ -0,0 +1,44 @@
+package tunnel
+
+import (
+	"context"
+
+	"github.com/containers/podman/v2/pkg/bindings/images"
+	"github.com/containers/podman/v2/pkg/domain/entities"
+	"github.com/pkg/errors"
+)
+
+// ImageEngine is the remote (tunnel) implementation of entities.ImageEngine.
+type ImageEngine struct {
+	ClientCtx context.Context
+}
+
+// Build builds an image on the remote Podman service.
+//
+// Platform selection, secrets, SSH forwarding, SBOM generation and --output
+// exporters all require the build tar upload, the REST build endpoint and
+// the response framing to carry additional data that the remote API does
+// not yet support.  Rather than silently building the wrong thing (e.g.
+// the daemon's default platform instead of the one requested, or leaking a
+// secret meant to stay local), Build refuses those requests until the
+// corresponding API bump lands.
+func (ir *ImageEngine) Build(ctx context.Context, containerFiles []string, opts entities.BuildOptions) (*entities.BuildReport, error) {
+	if len(opts.Platforms) > 0 || opts.ManifestName != "" {
+		return nil, errors.New("building for a specific platform, multiple platforms, or into a manifest list is not yet supported on a remote connection")
+	}
+	if len(opts.Secrets) > 0 || len(opts.SSHSources) > 0 {
+		return nil, errors.New("--secret and --ssh are not yet supported on a remote connection")
+	}
+	if opts.SBOM != nil {
+		return nil, errors.New("--sbom is not yet supported on a remote connection")
+	}
+	if len(opts.Exporters) > 0 {
+		return nil, errors.New("--output is not yet supported on a remote connection")
+	}
+
+	id, err := images.Build(ir.ClientCtx, containerFiles, opts.BuildOptions)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.BuildReport{ID: id}, nil
+}